@@ -2,17 +2,27 @@ package remote
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
+	"net"
+	"net/http"
+	"os"
 	"reflect"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-02-01/storage"
+	dataplanestorage "github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/azure/auth"
 	"github.com/mitchellh/mapstructure"
 
 	"github.com/gruntwork-io/terragrunt/errors"
 	"github.com/gruntwork-io/terragrunt/options"
+	"github.com/gruntwork-io/terragrunt/shell"
 	"github.com/gruntwork-io/terragrunt/util"
 )
 
@@ -29,8 +39,11 @@ type ExtendedRemoteStateConfigAzureRM struct {
 	Kind                     string            `mapstructure:"kind"`
 	AccessTier               string            `mapstructure:"access_tier"`
 	SkipVersioning           bool              `mapstructure:"skip_versioning"`
+	SkipContainerSoftDelete  bool              `mapstructure:"skip_container_soft_delete"`
 	SkipCreate               bool              `mapstructure:"skip_create"`
 	SkipAzureRBAC            bool              `mapstructure:"skip_azure_rbac"`
+	RoleDefinitionName       string            `mapstructure:"azurerm_role_definition_name"`
+	BootstrapLockBlob        bool              `mapstructure:"bootstrap_lock_blob"`
 }
 
 // A representation of the configuration options available for AzureRM remote state
@@ -69,8 +82,11 @@ var terragruntAzureRMOnlyConfigs = []string{
 	"kind",
 	"access_tier",
 	"skip_versioning",
+	"skip_container_soft_delete",
 	"skip_create",
 	"skip_azure_rbac",
+	"azurerm_role_definition_name",
+	"bootstrap_lock_blob",
 }
 
 const MAX_RETRIES_WAITING_FOR_AZURE_RM_BUCKET = 12
@@ -181,11 +197,25 @@ func (armInitializer AzureRMInitializer) Initialize(remoteState *RemoteState, te
 
 	// If bucket is specified and skip_bucket_versioning is false then warn user if versioning is disabled on bucket
 	if !armConfigExtended.SkipVersioning && armConfig.StorageAccountName != "" {
-		if err := checkIfAzureRMVersioningEnabled(armClient, &armConfig, terragruntOptions); err != nil {
+		if err := checkIfAzureRMVersioningEnabled(armClient, armConfigExtended, terragruntOptions); err != nil {
 			return err
 		}
 	}
 
+	// Terraform's azurerm backend locks state by acquiring a lease on the state blob, which requires the blob to
+	// already exist.
+	if armConfig.ContainerName != "" && armConfig.Key != "" {
+		if err := EnsureStateBlobExists(armClient, &armConfig, terragruntOptions); err != nil {
+			return err
+		}
+
+		if armConfigExtended.BootstrapLockBlob {
+			if err := bootstrapLockBlobPermissions(armClient, &armConfig, terragruntOptions); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -238,22 +268,148 @@ func validateAzureRMConfig(extendedConfig *ExtendedRemoteStateConfigAzureRM, ter
 		return errors.WithStackTrace(MissingRequiredAzureRMRemoteStateConfig("prefix"))
 	}
 
+	if !validAzureRMStorageAccountNameRegex.MatchString(config.StorageAccountName) {
+		return errors.WithStackTrace(InvalidAzureRMStorageAccountName(config.StorageAccountName))
+	}
+
+	kind := extendedConfig.Kind
+	if kind == "" {
+		kind = string(storage.KindStorageV2)
+	}
+
+	if !util.ListContainsElement(validAzureRMStorageKinds, kind) {
+		return errors.WithStackTrace(InvalidAzureRMStorageKind(kind))
+	}
+
+	if extendedConfig.SKU != "" {
+		if !util.ListContainsElement(validAzureRMStorageSKUs, extendedConfig.SKU) {
+			return errors.WithStackTrace(InvalidAzureRMStorageSKU(extendedConfig.SKU))
+		}
+
+		if extendedConfig.SKU == "Premium_LRS" && kind == string(storage.KindStorageV2) {
+			return errors.WithStackTrace(InvalidAzureRMSKUKindCombo{SKU: extendedConfig.SKU, Kind: kind})
+		}
+	}
+
+	if extendedConfig.AccessTier != "" {
+		if !util.ListContainsElement(validAzureRMAccessTiers, extendedConfig.AccessTier) {
+			return errors.WithStackTrace(InvalidAzureRMAccessTier(extendedConfig.AccessTier))
+		}
+
+		if extendedConfig.AccessTier == "Archive" && (kind == string(storage.KindBlockBlobStorage) || kind == string(storage.KindFileStorage)) {
+			return errors.WithStackTrace(InvalidAzureRMAccessTierKindCombo{AccessTier: extendedConfig.AccessTier, Kind: kind})
+		}
+	}
+
 	return nil
 }
 
+// validAzureRMStorageAccountNameRegex enforces the Azure naming rules for storage accounts: 3-24 characters,
+// lowercase letters and digits only.
+var validAzureRMStorageAccountNameRegex = regexp.MustCompile(`^[a-z0-9]{3,24}$`)
+
+var validAzureRMStorageKinds = []string{
+	string(storage.KindStorageV2),
+	string(storage.KindBlobStorage),
+	string(storage.KindBlockBlobStorage),
+	string(storage.KindFileStorage),
+}
+
+var validAzureRMAccessTiers = []string{
+	string(storage.AccessTierHot),
+	string(storage.AccessTierCool),
+	"Archive",
+}
+
 // If the storage account specified in the given config doesn't already exist, prompt the user to create it, and if the user
 // confirms, create the storage account and enable versioning for it.
 func createStorageAccountIfNecessary(armClient *storage.AccountsClient, config *ExtendedRemoteStateConfigAzureRM, terragruntOptions *options.TerragruntOptions) error {
-	return nil
+	storageAccountName := config.remoteStateConfigAzureRM.StorageAccountName
+
+	exists, err := DoesStorageAccountExist(armClient, &config.remoteStateConfigAzureRM)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	prompt := fmt.Sprintf("Remote state Azure storage account %s does not exist or you don't have permissions to access it. Would you like Terragrunt to create it?", storageAccountName)
+	shouldCreateStorageAccount, err := shell.PromptUserForYesNo(prompt, terragruntOptions)
+	if err != nil {
+		return err
+	}
+
+	if !shouldCreateStorageAccount {
+		return nil
+	}
+
+	return CreateAzureRMBucket(armClient, config, terragruntOptions)
 }
 
 // Check if versioning is enabled for the AzureRM storage account specified in the given config and warn the user if it is not
-func checkIfAzureRMVersioningEnabled(armClient *storage.AccountsClient, config *RemoteStateConfigAzureRM, terragruntOptions *options.TerragruntOptions) error {
+func checkIfAzureRMVersioningEnabled(armClient *storage.AccountsClient, config *ExtendedRemoteStateConfigAzureRM, terragruntOptions *options.TerragruntOptions) error {
+	armConfig := config.remoteStateConfigAzureRM
+
+	blobServicesClient := storage.NewBlobServicesClientWithBaseURI(armClient.BaseURI, armClient.SubscriptionID)
+	blobServicesClient.Authorizer = armClient.Authorizer
+	blobServicesClient.AddToUserAgent("terragrunt-cli")
+
+	properties, err := blobServicesClient.GetServiceProperties(context.Background(), armConfig.ResourceGroupName, armConfig.StorageAccountName)
+	if err != nil {
+		return errors.WithStackTrace(err)
+	}
+
+	versioningEnabled := properties.BlobServicePropertiesProperties != nil &&
+		properties.BlobServicePropertiesProperties.IsVersioningEnabled != nil &&
+		*properties.BlobServicePropertiesProperties.IsVersioningEnabled
+
+	if !versioningEnabled {
+		terragruntOptions.Logger.Warnf("Versioning is not enabled for the remote state storage account %s, and it is recommended that you enable it so your Terraform state has point-in-time recovery in case of corruption.", armConfig.StorageAccountName)
+	}
+
 	return nil
 }
 
-// createStorageAccountWithVersioning creates the given AzureRM storage account and enables versioning for it.
+// createStorageAccountWithVersioning enables blob versioning, the change feed, and (unless skip_container_soft_delete
+// is set) a 7-day blob soft-delete retention policy on a newly created storage account, so Terraform state gets the same point-in-time
+// recovery guarantees Terragrunt provides for the S3 and GCS backends.
 func createStorageAccountWithVersioning(armClient *storage.AccountsClient, config *ExtendedRemoteStateConfigAzureRM, terragruntOptions *options.TerragruntOptions) error {
+	armConfig := config.remoteStateConfigAzureRM
+
+	blobServicesClient := storage.NewBlobServicesClientWithBaseURI(armClient.BaseURI, armClient.SubscriptionID)
+	blobServicesClient.Authorizer = armClient.Authorizer
+	blobServicesClient.AddToUserAgent("terragrunt-cli")
+
+	versioningEnabled := true
+	changeFeedEnabled := true
+
+	properties := storage.BlobServiceProperties{
+		BlobServicePropertiesProperties: &storage.BlobServicePropertiesProperties{
+			IsVersioningEnabled: &versioningEnabled,
+			ChangeFeed: &storage.ChangeFeed{
+				Enabled: &changeFeedEnabled,
+			},
+		},
+	}
+
+	if !config.SkipContainerSoftDelete {
+		deleteRetentionEnabled := true
+		retentionDays := int32(7)
+
+		properties.BlobServicePropertiesProperties.DeleteRetentionPolicy = &storage.DeleteRetentionPolicy{
+			Enabled: &deleteRetentionEnabled,
+			Days:    &retentionDays,
+		}
+	}
+
+	terragruntOptions.Logger.Debugf("Enabling blob versioning and soft-delete on storage account %s", armConfig.StorageAccountName)
+
+	if _, err := blobServicesClient.SetServiceProperties(context.Background(), armConfig.ResourceGroupName, armConfig.StorageAccountName, properties); err != nil {
+		return errors.WithStackTrace(err)
+	}
+
 	return nil
 }
 
@@ -263,18 +419,164 @@ func AddLabelsToAzureRMBucket(armClient *storage.AccountsClient, config *Extende
 
 // Create the AzureRM storage account specified in the given config
 func CreateAzureRMBucket(armClient *storage.AccountsClient, config *ExtendedRemoteStateConfigAzureRM, terragruntOptions *options.TerragruntOptions) error {
-	return nil
+	armConfig := config.remoteStateConfigAzureRM
+
+	terragruntOptions.Logger.Debugf("Creating AzureRM storage account %s", armConfig.StorageAccountName)
+
+	sku, err := skuForAzureRMStorageAccount(config.SKU)
+	if err != nil {
+		return err
+	}
+
+	kind := storage.KindStorageV2
+	if config.Kind != "" {
+		kind = storage.Kind(config.Kind)
+	}
+
+	createParameters := storage.AccountCreateParameters{
+		Sku:                               sku,
+		Kind:                              kind,
+		Location:                          &config.Location,
+		AccountPropertiesCreateParameters: &storage.AccountPropertiesCreateParameters{},
+		Tags:                              toAzureRMTags(config.Tags),
+	}
+
+	if config.AccessTier != "" {
+		createParameters.AccountPropertiesCreateParameters.AccessTier = storage.AccessTier(config.AccessTier)
+	}
+
+	ctx := context.Background()
+
+	future, err := armClient.Create(ctx, armConfig.ResourceGroupName, armConfig.StorageAccountName, createParameters)
+	if err != nil {
+		return errors.WithStackTrace(AzureRMStorageAccountCreationError{StorageAccountName: armConfig.StorageAccountName, UnderlyingErr: err})
+	}
+
+	if err := future.WaitForCompletionRef(ctx, armClient.Client); err != nil {
+		return errors.WithStackTrace(AzureRMStorageAccountCreationError{StorageAccountName: armConfig.StorageAccountName, UnderlyingErr: err})
+	}
+
+	terragruntOptions.Logger.Debugf("Created AzureRM storage account %s", armConfig.StorageAccountName)
+
+	if err := WaitUntilAzureRMBucketExists(armClient, &armConfig, terragruntOptions); err != nil {
+		return err
+	}
+
+	if err := createBlobContainerIfNecessary(armClient, &armConfig, terragruntOptions); err != nil {
+		return err
+	}
+
+	if !config.SkipVersioning {
+		if err := createStorageAccountWithVersioning(armClient, config, terragruntOptions); err != nil {
+			return err
+		}
+	}
+
+	if config.SkipAzureRBAC {
+		return nil
+	}
+
+	return assignAzureRMRBACRoleIfNecessary(armClient, config, terragruntOptions)
 }
 
 // GCP is eventually consistent, so after creating a AzureRM storage account, this method can be used to wait until the information
 // about that AzureRM storage account has propagated everywhere.
 func WaitUntilAzureRMBucketExists(armClient *storage.AccountsClient, config *RemoteStateConfigAzureRM, terragruntOptions *options.TerragruntOptions) error {
+	for retries := 0; retries < MAX_RETRIES_WAITING_FOR_AZURE_RM_BUCKET; retries++ {
+		exists, err := DoesStorageAccountExist(armClient, config)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return nil
+		}
+
+		terragruntOptions.Logger.Debugf("Storage account %s still not showing up yet. Sleeping for %v and will check again.", config.StorageAccountName, SLEEP_BETWEEN_RETRIES_WAITING_FOR_AZURE_RM_BUCKET)
+		time.Sleep(SLEEP_BETWEEN_RETRIES_WAITING_FOR_AZURE_RM_BUCKET)
+	}
+
+	return errors.WithStackTrace(MaxRetriesWaitingForAzureRMBucketExceeded(config.StorageAccountName))
+}
+
+// createBlobContainerIfNecessary creates the blob container used to store the Terraform state, if it does not already exist,
+// inside the given storage account.
+func createBlobContainerIfNecessary(armClient *storage.AccountsClient, config *RemoteStateConfigAzureRM, terragruntOptions *options.TerragruntOptions) error {
+	if config.ContainerName == "" {
+		return nil
+	}
+
+	// When an access key or SAS token is configured, the container is created through the data plane too, for the
+	// same reason DoesStorageAccountExist avoids ARM in that case: the configured credential may not have the
+	// Microsoft.Storage/storageAccounts/blobServices/containers/write permission that blobContainersClient needs.
+	if config.AccessKey != "" || config.SASToken != "" {
+		return createBlobContainerViaDataPlane(config, terragruntOptions)
+	}
+
+	blobContainersClient := storage.NewBlobContainersClientWithBaseURI(armClient.BaseURI, armClient.SubscriptionID)
+	blobContainersClient.Authorizer = armClient.Authorizer
+	blobContainersClient.AddToUserAgent("terragrunt-cli")
+
+	ctx := context.Background()
+
+	if _, err := blobContainersClient.Get(ctx, config.ResourceGroupName, config.StorageAccountName, config.ContainerName); err == nil {
+		return nil
+	}
+
+	terragruntOptions.Logger.Debugf("Creating blob container %s in storage account %s", config.ContainerName, config.StorageAccountName)
+
+	if _, err := blobContainersClient.Create(ctx, config.ResourceGroupName, config.StorageAccountName, config.ContainerName, storage.BlobContainer{}); err != nil {
+		return errors.WithStackTrace(AzureRMBlobContainerCreationError{ContainerName: config.ContainerName, UnderlyingErr: err})
+	}
+
 	return nil
 }
 
+// skuForAzureRMStorageAccount validates the given SKU name against the set of SKUs ARM accepts for storage accounts
+// and returns the corresponding storage.Sku. An empty skuName defaults to Standard_LRS.
+func skuForAzureRMStorageAccount(skuName string) (*storage.Sku, error) {
+	if skuName == "" {
+		return &storage.Sku{Name: storage.SkuNameStandardLRS}, nil
+	}
+
+	if !util.ListContainsElement(validAzureRMStorageSKUs, skuName) {
+		return nil, errors.WithStackTrace(InvalidAzureRMStorageSKU(skuName))
+	}
+
+	return &storage.Sku{Name: storage.SkuName(skuName)}, nil
+}
+
+// toAzureRMTags converts a plain map of tags into the *string map the AzureRM SDK expects.
+func toAzureRMTags(tags map[string]string) map[string]*string {
+	armTags := make(map[string]*string, len(tags))
+	for key, value := range tags {
+		value := value
+		armTags[key] = &value
+	}
+
+	return armTags
+}
+
+var validAzureRMStorageSKUs = []string{
+	"Standard_LRS",
+	"Standard_GRS",
+	"Standard_RAGRS",
+	"Standard_ZRS",
+	"Standard_GZRS",
+	"Standard_RAGZRS",
+	"Premium_LRS",
+	"Premium_ZRS",
+}
+
 // DoesStorageAccountExist returns true if the AzureRM storage account specified in the given config exists and the current user has the
-// ability to access it.
+// ability to access it. If an access key or SAS token is configured, the check is done against the data plane
+// directly, since CheckNameAvailability requires management-plane RBAC the caller may not have when using those
+// credential types.
 func DoesStorageAccountExist(armClient *storage.AccountsClient, config *RemoteStateConfigAzureRM) (bool, error) {
+	if config.AccessKey != "" || config.SASToken != "" {
+		return doesStorageAccountExistViaDataPlane(config)
+	}
+
 	ctx := context.Background()
 
 	accountCheckNameAvailabilityParameters := storage.AccountCheckNameAvailabilityParameters{
@@ -295,19 +597,248 @@ func DoesStorageAccountExist(armClient *storage.AccountsClient, config *RemoteSt
 	return true, nil
 }
 
-// CreateAzureRMClient creates an authenticated client for AzureRM
+// doesStorageAccountExistViaDataPlane checks for the storage account's existence directly, by asking its blob
+// service for its properties, authenticating with the configured access key or SAS token instead of an ARM
+// authorizer. This deliberately checks the account itself rather than config.ContainerName: the container may not
+// have been created yet even though the account exists, and conflating the two would send an existing account
+// through the creation flow again.
+func doesStorageAccountExistViaDataPlane(config *RemoteStateConfigAzureRM) (bool, error) {
+	dataPlaneClient, err := dataPlaneClientForAzureRM(config)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := dataPlaneClient.GetBlobService().GetServiceProperties(); err != nil {
+		if isAzureStorageAccountNotFoundError(err) {
+			return false, nil
+		}
+
+		// If the check fails for any other reason, assume the storage account exists, mirroring the
+		// management-plane CheckNameAvailability fallback above. The error will contain the reason the check
+		// failed, which is returned to the caller.
+		return true, err
+	}
+
+	return true, nil
+}
+
+// dataPlaneClientForAzureRM builds a data-plane storage client authenticated with the configured access key or SAS
+// token, pointed at the blob endpoint of the resolved Azure environment.
+func dataPlaneClientForAzureRM(config *RemoteStateConfigAzureRM) (dataplanestorage.Client, error) {
+	env, err := azureRMEnvironment(*config)
+	if err != nil {
+		return dataplanestorage.Client{}, err
+	}
+
+	var dataPlaneClient dataplanestorage.Client
+
+	if config.AccessKey != "" {
+		dataPlaneClient, err = dataplanestorage.NewClient(config.StorageAccountName, config.AccessKey, env.StorageEndpointSuffix, dataplanestorage.DefaultAPIVersion, true)
+	} else {
+		endpoint := fmt.Sprintf("https://%s.blob.%s", config.StorageAccountName, env.StorageEndpointSuffix)
+		dataPlaneClient, err = dataplanestorage.NewAccountSASClientFromEndpointToken(endpoint, config.SASToken)
+	}
+	if err != nil {
+		return dataplanestorage.Client{}, errors.WithStackTrace(AzureRMAuthError{Method: "data-plane credential", UnderlyingErr: err})
+	}
+
+	return dataPlaneClient, nil
+}
+
+// doesBlobContainerExistViaDataPlane checks for the state container's existence directly against the data plane,
+// for the access-key/SAS auth paths that can't rely on ARM.
+func doesBlobContainerExistViaDataPlane(config *RemoteStateConfigAzureRM) (bool, error) {
+	dataPlaneClient, err := dataPlaneClientForAzureRM(config)
+	if err != nil {
+		return false, err
+	}
+
+	exists, err := dataPlaneClient.GetBlobService().GetContainerReference(config.ContainerName).Exists()
+	if err != nil {
+		return false, errors.WithStackTrace(err)
+	}
+
+	return exists, nil
+}
+
+// createBlobContainerViaDataPlane creates the state container directly against the data plane, for the
+// access-key/SAS auth paths that can't rely on ARM's blobContainersClient.
+func createBlobContainerViaDataPlane(config *RemoteStateConfigAzureRM, terragruntOptions *options.TerragruntOptions) error {
+	exists, err := doesBlobContainerExistViaDataPlane(config)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	dataPlaneClient, err := dataPlaneClientForAzureRM(config)
+	if err != nil {
+		return err
+	}
+
+	terragruntOptions.Logger.Debugf("Creating blob container %s in storage account %s via the data plane", config.ContainerName, config.StorageAccountName)
+
+	if err := dataPlaneClient.GetBlobService().GetContainerReference(config.ContainerName).Create(nil); err != nil {
+		return errors.WithStackTrace(AzureRMBlobContainerCreationError{ContainerName: config.ContainerName, UnderlyingErr: err})
+	}
+
+	return nil
+}
+
+// isAzureStorageAccountNotFoundError returns true if the given error indicates the storage account itself doesn't
+// exist: either the data plane rejected the request with a 404, or the account's hostname didn't resolve at all.
+func isAzureStorageAccountNotFoundError(err error) bool {
+	if storageErr, ok := err.(dataplanestorage.AzureStorageServiceError); ok {
+		return storageErr.StatusCode == http.StatusNotFound
+	}
+
+	var dnsErr *net.DNSError
+	if stderrors.As(err, &dnsErr) {
+		return dnsErr.IsNotFound
+	}
+
+	return false
+}
+
+// CreateAzureRMClient creates an authenticated client for the AzureRM management plane, pointed at the ARM endpoint
+// of the configured cloud (public, a sovereign cloud, or an Azure Stack instance).
 func CreateAzureRMClient(armConfigRemote RemoteStateConfigAzureRM) (*storage.AccountsClient, error) {
-	authorizer, err := auth.NewAuthorizerFromEnvironment()
+	env, err := azureRMEnvironment(armConfigRemote)
+	if err != nil {
+		return nil, err
+	}
+
+	authorizer, err := authorizerForAzureRM(armConfigRemote, env)
 	if err != nil {
 		return nil, err
 	}
-	storageAccountsClient := storage.NewAccountsClient(armConfigRemote.SubscriptionId)
+
+	storageAccountsClient := storage.NewAccountsClientWithBaseURI(env.ResourceManagerEndpoint, armConfigRemote.SubscriptionId)
 	storageAccountsClient.Authorizer = authorizer
 	storageAccountsClient.AddToUserAgent("terragrunt-cli")
 
 	return &storageAccountsClient, nil
 }
 
+// azureRMEnvironment resolves the azure.Environment to use for every management call, based on the configured
+// "environment" (a sovereign cloud name such as usgovernment, china, or german) or "endpoint" (an Azure Stack
+// metadata endpoint), defaulting to the public cloud when neither is set.
+func azureRMEnvironment(config RemoteStateConfigAzureRM) (azure.Environment, error) {
+	switch {
+	case strings.EqualFold(config.Environment, "stack"):
+		if config.Endpoint == "" {
+			return azure.Environment{}, errors.WithStackTrace(MissingRequiredAzureRMRemoteStateConfig("endpoint"))
+		}
+
+		env, err := azure.EnvironmentFromURL(config.Endpoint)
+		if err != nil {
+			return azure.Environment{}, errors.WithStackTrace(err)
+		}
+
+		return env, nil
+
+	case config.Environment != "":
+		// Map the short cloud names accepted in the environment field onto the names azure.EnvironmentFromName knows.
+		name := config.Environment
+		switch strings.ToLower(name) {
+		case "public":
+			name = "AzurePublicCloud"
+		case "usgovernment":
+			name = "AzureUSGovernmentCloud"
+		case "china":
+			name = "AzureChinaCloud"
+		case "german":
+			name = "AzureGermanCloud"
+		}
+
+		env, err := azure.EnvironmentFromName(name)
+		if err != nil {
+			return azure.Environment{}, errors.WithStackTrace(err)
+		}
+
+		return env, nil
+
+	case config.Endpoint != "":
+		env, err := azure.EnvironmentFromURL(config.Endpoint)
+		if err != nil {
+			return azure.Environment{}, errors.WithStackTrace(err)
+		}
+
+		return env, nil
+
+	default:
+		return azure.PublicCloud, nil
+	}
+}
+
+// authorizerForAzureRM picks the first usable management-plane credential, in the same precedence Terraform's
+// azurerm backend uses: client certificate, then client secret, then MSI, falling back to whatever the AZURE_*
+// environment variables describe (client secret, client certificate or username/password, otherwise a managed
+// identity). An Azure CLI (`az login`) session is not used. Every
+// authorizer is scoped to the given environment's Active Directory and Resource Manager endpoints, so the same
+// dispatcher works for sovereign clouds and Azure Stack. Access keys and SAS tokens are data-plane-only credentials
+// and are handled separately by DoesStorageAccountExist; they do not produce a management-plane authorizer.
+func authorizerForAzureRM(config RemoteStateConfigAzureRM, env azure.Environment) (autorest.Authorizer, error) {
+	if config.ClientCertificatePath != "" {
+		certConfig := auth.NewClientCertificateConfig(config.ClientCertificatePath, config.ClientCertificatePassword, config.ClientId, config.TenantId)
+		certConfig.AADEndpoint = env.ActiveDirectoryEndpoint
+		certConfig.Resource = env.ResourceManagerEndpoint
+
+		authorizer, err := certConfig.Authorizer()
+		if err != nil {
+			return nil, errors.WithStackTrace(AzureRMAuthError{Method: "client certificate", UnderlyingErr: err})
+		}
+
+		return authorizer, nil
+	}
+
+	if config.ClientId != "" && config.ClientSecret != "" {
+		secretConfig := auth.NewClientCredentialsConfig(config.ClientId, config.ClientSecret, config.TenantId)
+		secretConfig.AADEndpoint = env.ActiveDirectoryEndpoint
+		secretConfig.Resource = env.ResourceManagerEndpoint
+
+		authorizer, err := secretConfig.Authorizer()
+		if err != nil {
+			return nil, errors.WithStackTrace(AzureRMAuthError{Method: "client secret", UnderlyingErr: err})
+		}
+
+		return authorizer, nil
+	}
+
+	if useMSI, err := strconv.ParseBool(config.UseMSI); err == nil && useMSI {
+		if config.MSIEndpoint != "" {
+			os.Setenv("MSI_ENDPOINT", config.MSIEndpoint)
+		}
+
+		msiConfig := auth.NewMSIConfig()
+		msiConfig.Resource = env.ResourceManagerEndpoint
+
+		authorizer, err := msiConfig.Authorizer()
+		if err != nil {
+			return nil, errors.WithStackTrace(AzureRMAuthError{Method: "MSI", UnderlyingErr: err})
+		}
+
+		return authorizer, nil
+	}
+
+	settings, err := auth.GetSettingsFromEnvironment()
+	if err != nil {
+		return nil, errors.WithStackTrace(AzureRMAuthError{Method: "environment", UnderlyingErr: err})
+	}
+
+	settings.Environment = env
+	settings.Values[auth.Resource] = env.ResourceManagerEndpoint
+
+	authorizer, err := settings.GetAuthorizer()
+	if err != nil {
+		return nil, errors.WithStackTrace(AzureRMAuthError{Method: "environment", UnderlyingErr: err})
+	}
+
+	return authorizer, nil
+}
+
 // Custom error types
 
 type MissingRequiredAzureRMRemoteStateConfig string
@@ -316,6 +847,110 @@ func (configName MissingRequiredAzureRMRemoteStateConfig) Error() string {
 	return fmt.Sprintf("Missing required AzureRM remote state configuration %s", string(configName))
 }
 
+// AzureRMStorageAccountCreationError is returned when the ARM API rejects or fails to complete a storage account
+// creation, e.g. due to a quota limit or a storage account name that is already taken globally.
+type AzureRMStorageAccountCreationError struct {
+	StorageAccountName string
+	UnderlyingErr      error
+}
+
+func (err AzureRMStorageAccountCreationError) Error() string {
+	return fmt.Sprintf("Error creating AzureRM storage account %s: %v", err.StorageAccountName, err.UnderlyingErr)
+}
+
+func (err AzureRMStorageAccountCreationError) Unwrap() error {
+	return err.UnderlyingErr
+}
+
+// AzureRMBlobContainerCreationError is returned when the ARM API fails to create the blob container used to store
+// the Terraform state.
+type AzureRMBlobContainerCreationError struct {
+	ContainerName string
+	UnderlyingErr error
+}
+
+func (err AzureRMBlobContainerCreationError) Error() string {
+	return fmt.Sprintf("Error creating blob container %s: %v", err.ContainerName, err.UnderlyingErr)
+}
+
+func (err AzureRMBlobContainerCreationError) Unwrap() error {
+	return err.UnderlyingErr
+}
+
+// AzureRMAuthError is returned when a configured authentication method fails to produce a usable authorizer, so
+// users can see exactly which credential path was attempted and why it failed.
+type AzureRMAuthError struct {
+	Method        string
+	UnderlyingErr error
+}
+
+func (err AzureRMAuthError) Error() string {
+	return fmt.Sprintf("Error authenticating to AzureRM via %s: %v", err.Method, err.UnderlyingErr)
+}
+
+func (err AzureRMAuthError) Unwrap() error {
+	return err.UnderlyingErr
+}
+
+// InvalidAzureRMStorageSKU is returned when the configured sku is not one ARM accepts for storage accounts.
+type InvalidAzureRMStorageSKU string
+
+func (sku InvalidAzureRMStorageSKU) Error() string {
+	return fmt.Sprintf("Invalid AzureRM storage account sku %s", string(sku))
+}
+
+// MaxRetriesWaitingForAzureRMBucketExceeded is returned when a storage account still hasn't shown up as existing
+// after MAX_RETRIES_WAITING_FOR_AZURE_RM_BUCKET retries.
+type MaxRetriesWaitingForAzureRMBucketExceeded string
+
+func (err MaxRetriesWaitingForAzureRMBucketExceeded) Error() string {
+	return fmt.Sprintf("Exceeded max retries waiting for storage account %s to be created", string(err))
+}
+
+// InvalidAzureRMStorageAccountName is returned when the configured storage_account_name doesn't meet Azure's naming
+// rules (3-24 characters, lowercase letters and digits only).
+type InvalidAzureRMStorageAccountName string
+
+func (name InvalidAzureRMStorageAccountName) Error() string {
+	return fmt.Sprintf("Invalid AzureRM storage account name %q: must be 3-24 characters and contain only lowercase letters and numbers", string(name))
+}
+
+// InvalidAzureRMStorageKind is returned when the configured kind is not one ARM accepts for storage accounts.
+type InvalidAzureRMStorageKind string
+
+func (kind InvalidAzureRMStorageKind) Error() string {
+	return fmt.Sprintf("Invalid AzureRM storage account kind %s", string(kind))
+}
+
+// InvalidAzureRMSKUKindCombo is returned when the configured sku and kind are each individually valid, but ARM
+// rejects the combination of the two.
+type InvalidAzureRMSKUKindCombo struct {
+	SKU  string
+	Kind string
+}
+
+func (err InvalidAzureRMSKUKindCombo) Error() string {
+	return fmt.Sprintf("AzureRM does not support sku %s with kind %s", err.SKU, err.Kind)
+}
+
+// InvalidAzureRMAccessTier is returned when the configured access_tier is not one ARM accepts.
+type InvalidAzureRMAccessTier string
+
+func (accessTier InvalidAzureRMAccessTier) Error() string {
+	return fmt.Sprintf("Invalid AzureRM storage account access tier %s", string(accessTier))
+}
+
+// InvalidAzureRMAccessTierKindCombo is returned when the configured access_tier is not one the configured kind can
+// host, e.g. the Archive tier on a BlockBlobStorage or FileStorage account.
+type InvalidAzureRMAccessTierKindCombo struct {
+	AccessTier string
+	Kind       string
+}
+
+func (err InvalidAzureRMAccessTierKindCombo) Error() string {
+	return fmt.Sprintf("AzureRM does not support access tier %s with kind %s", err.AccessTier, err.Kind)
+}
+
 func Coalesce(strings ...string) (string, error) {
 	for _, str := range strings {
 		if str != "" {
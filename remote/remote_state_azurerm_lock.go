@@ -0,0 +1,197 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/azblob"
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-02-01/storage"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	"github.com/gruntwork-io/terragrunt/errors"
+	"github.com/gruntwork-io/terragrunt/options"
+)
+
+// bootstrapLockBlobLeaseDuration is the lease duration, in seconds, used to verify data-plane write access to the
+// state blob. This is the shortest duration azblob's fixed-duration leases accept.
+const bootstrapLockBlobLeaseDuration = 15 * time.Second
+
+// EnsureStateBlobExists makes sure the blob that Terraform's azurerm backend acquires a lease on to lock state
+// already exists, since a lease cannot be taken out on a blob that hasn't been created yet. It PUTs an empty block
+// blob with an If-None-Match: * condition, so that concurrent Terragrunt runs race safely and only the first one
+// to get there actually creates it.
+func EnsureStateBlobExists(armClient *storage.AccountsClient, config *RemoteStateConfigAzureRM, terragruntOptions *options.TerragruntOptions) error {
+	blobURL, err := stateBlobURL(armClient, config)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	if _, err := blobURL.GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{}); err == nil {
+		return nil
+	}
+
+	terragruntOptions.Logger.Debugf("State blob %s does not exist yet in container %s; creating an empty placeholder so Terraform's blob-lease locking has something to lease", config.Key, config.ContainerName)
+
+	accessConditions := azblob.BlobAccessConditions{
+		ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfNoneMatch: azblob.ETagAny},
+	}
+
+	_, err = blobURL.Upload(ctx, strings.NewReader(""), azblob.BlobHTTPHeaders{}, azblob.Metadata{}, accessConditions, azblob.DefaultAccessTier, nil, azblob.ClientProvidedKeyOptions{}, azblob.ImmutabilityPolicyOptions{})
+	if err != nil && !isBlobAlreadyExistsError(err) {
+		return errors.WithStackTrace(AzureRMStateBlobCreationError{Key: config.Key, UnderlyingErr: err})
+	}
+
+	return nil
+}
+
+// bootstrapLockBlobPermissions acquires and immediately releases a short lease on the state blob, to turn a
+// data-plane permission problem into an upfront, actionable error instead of a confusing failure once Terraform
+// itself tries to lock state.
+func bootstrapLockBlobPermissions(armClient *storage.AccountsClient, config *RemoteStateConfigAzureRM, terragruntOptions *options.TerragruntOptions) error {
+	blobURL, err := stateBlobURL(armClient, config)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	terragruntOptions.Logger.Debugf("Verifying data-plane write access to state blob %s by acquiring a %v lease", config.Key, bootstrapLockBlobLeaseDuration)
+
+	leaseResp, err := blobURL.AcquireLease(ctx, "", int32(bootstrapLockBlobLeaseDuration.Seconds()), azblob.ModifiedAccessConditions{})
+	if err != nil {
+		return errors.WithStackTrace(AzureRMLockBlobError{Key: config.Key, UnderlyingErr: err})
+	}
+
+	if _, err := blobURL.ReleaseLease(ctx, leaseResp.LeaseID(), azblob.ModifiedAccessConditions{}); err != nil {
+		return errors.WithStackTrace(AzureRMLockBlobError{Key: config.Key, UnderlyingErr: err})
+	}
+
+	return nil
+}
+
+// stateBlobURL builds an azblob.BlockBlobURL for the state blob, pointed at the blob endpoint of the resolved Azure
+// environment (public, a sovereign cloud, or Azure Stack) and authenticated with the resolved data-plane
+// credential: the configured SAS token or access key if present, otherwise the account's primary key fetched
+// through the management plane.
+func stateBlobURL(armClient *storage.AccountsClient, config *RemoteStateConfigAzureRM) (azblob.BlockBlobURL, error) {
+	env, err := azureRMEnvironment(*config)
+	if err != nil {
+		return azblob.BlockBlobURL{}, err
+	}
+
+	rawURL := fmt.Sprintf("https://%s/%s/%s", storageAccountBlobHost(config.StorageAccountName, env), config.ContainerName, config.Key)
+
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return azblob.BlockBlobURL{}, errors.WithStackTrace(err)
+	}
+
+	// A SAS token is itself a data-plane credential scoped to the container/blob, so it's appended to the URL and
+	// authenticated with an anonymous pipeline credential rather than going through ARM at all.
+	if config.SASToken != "" {
+		sasValues, err := url.ParseQuery(strings.TrimPrefix(config.SASToken, "?"))
+		if err != nil {
+			return azblob.BlockBlobURL{}, errors.WithStackTrace(err)
+		}
+
+		parsedURL.RawQuery = sasValues.Encode()
+
+		pipeline := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{})
+
+		return azblob.NewBlockBlobURL(*parsedURL, pipeline), nil
+	}
+
+	credential, err := dataPlaneCredentialForAzureRM(armClient, config)
+	if err != nil {
+		return azblob.BlockBlobURL{}, err
+	}
+
+	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+
+	return azblob.NewBlockBlobURL(*parsedURL, pipeline), nil
+}
+
+// storageAccountBlobHost returns the blob-service hostname for the given storage account in the resolved Azure
+// environment, honoring sovereign clouds and Azure Stack's custom storage endpoint suffix instead of assuming
+// core.windows.net.
+func storageAccountBlobHost(storageAccountName string, env azure.Environment) string {
+	return fmt.Sprintf("%s.blob.%s", storageAccountName, env.StorageEndpointSuffix)
+}
+
+// dataPlaneCredentialForAzureRM resolves a SharedKeyCredential for data-plane blob operations from the configured
+// access key, or, failing that, the storage account's primary key fetched via the management plane. SAS tokens are
+// handled separately by stateBlobURL, since they authenticate the pipeline itself rather than producing a
+// SharedKeyCredential.
+func dataPlaneCredentialForAzureRM(armClient *storage.AccountsClient, config *RemoteStateConfigAzureRM) (*azblob.SharedKeyCredential, error) {
+	if config.AccessKey != "" {
+		credential, err := azblob.NewSharedKeyCredential(config.StorageAccountName, config.AccessKey)
+		if err != nil {
+			return nil, errors.WithStackTrace(AzureRMAuthError{Method: "access key", UnderlyingErr: err})
+		}
+
+		return credential, nil
+	}
+
+	keysResult, err := armClient.ListKeys(context.Background(), config.ResourceGroupName, config.StorageAccountName, "")
+	if err != nil {
+		return nil, errors.WithStackTrace(AzureRMAuthError{Method: "storage account keys", UnderlyingErr: err})
+	}
+
+	if keysResult.Keys == nil || len(*keysResult.Keys) == 0 {
+		return nil, errors.WithStackTrace(AzureRMAuthError{Method: "storage account keys", UnderlyingErr: fmt.Errorf("no access keys are available for storage account %s", config.StorageAccountName)})
+	}
+
+	accountKey := *(*keysResult.Keys)[0].Value
+
+	credential, err := azblob.NewSharedKeyCredential(config.StorageAccountName, accountKey)
+	if err != nil {
+		return nil, errors.WithStackTrace(AzureRMAuthError{Method: "storage account keys", UnderlyingErr: err})
+	}
+
+	return credential, nil
+}
+
+// isBlobAlreadyExistsError returns true if the given error is the 409 Conflict azblob returns when the
+// If-None-Match: * precondition fails because another concurrent run already created the blob first.
+func isBlobAlreadyExistsError(err error) bool {
+	storageErr, ok := err.(azblob.StorageError)
+	if !ok {
+		return false
+	}
+
+	return storageErr.ServiceCode() == azblob.ServiceCodeBlobAlreadyExists
+}
+
+// AzureRMStateBlobCreationError is returned when Terragrunt fails to pre-create the empty state blob that
+// Terraform's blob-lease locking requires to exist before a lease can be acquired on it.
+type AzureRMStateBlobCreationError struct {
+	Key           string
+	UnderlyingErr error
+}
+
+func (err AzureRMStateBlobCreationError) Error() string {
+	return fmt.Sprintf("Error creating placeholder state blob %s: %v", err.Key, err.UnderlyingErr)
+}
+
+func (err AzureRMStateBlobCreationError) Unwrap() error {
+	return err.UnderlyingErr
+}
+
+// AzureRMLockBlobError is returned when the bootstrap lease check against the state blob fails.
+type AzureRMLockBlobError struct {
+	Key           string
+	UnderlyingErr error
+}
+
+func (err AzureRMLockBlobError) Error() string {
+	return fmt.Sprintf("Error verifying lease permissions on state blob %s: %v", err.Key, err.UnderlyingErr)
+}
+
+func (err AzureRMLockBlobError) Unwrap() error {
+	return err.UnderlyingErr
+}
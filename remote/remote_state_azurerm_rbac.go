@@ -0,0 +1,235 @@
+package remote
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/authorization/mgmt/2015-07-01/authorization"
+	"github.com/Azure/azure-sdk-for-go/services/graphrbac/1.6/graphrbac"
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-02-01/storage"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/azure/auth"
+	"github.com/google/uuid"
+
+	"github.com/gruntwork-io/terragrunt/errors"
+	"github.com/gruntwork-io/terragrunt/options"
+)
+
+// defaultAzureRMRoleDefinitionName is the role granted on a newly created storage account so that
+// use_azuread_auth=true backends can read/write blobs immediately, without a separate manual RBAC step.
+const defaultAzureRMRoleDefinitionName = "Storage Blob Data Contributor"
+
+// assignAzureRMRBACRoleIfNecessary grants the configured role (Storage Blob Data Contributor by default) on the
+// storage account Terragrunt just created to the principal it authenticated as. This closes the common gap where a
+// service principal can create the account through ARM but then can't read or write blobs because it was never
+// granted data-plane access.
+func assignAzureRMRBACRoleIfNecessary(armClient *storage.AccountsClient, config *ExtendedRemoteStateConfigAzureRM, terragruntOptions *options.TerragruntOptions) error {
+	armConfig := config.remoteStateConfigAzureRM
+
+	env, err := azureRMEnvironment(armConfig)
+	if err != nil {
+		return err
+	}
+
+	principalID, err := principalIDForAzureRM(armConfig, env)
+	if err != nil {
+		terragruntOptions.Logger.Warnf("Could not resolve the current principal to assign an Azure RBAC role on storage account %s: %v. Skipping automatic role assignment.", armConfig.StorageAccountName, err)
+		return nil
+	}
+
+	roleDefinitionName := config.RoleDefinitionName
+	if roleDefinitionName == "" {
+		roleDefinitionName = defaultAzureRMRoleDefinitionName
+	}
+
+	scope := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Storage/storageAccounts/%s", armConfig.SubscriptionId, armConfig.ResourceGroupName, armConfig.StorageAccountName)
+
+	roleDefinitionsClient := authorization.NewRoleDefinitionsClientWithBaseURI(env.ResourceManagerEndpoint, armConfig.SubscriptionId)
+	roleDefinitionsClient.Authorizer = armClient.Authorizer
+
+	roleDefinitionID, err := roleDefinitionIDByName(roleDefinitionsClient, scope, roleDefinitionName)
+	if err != nil {
+		terragruntOptions.Logger.Warnf("Could not look up the Azure role definition %s: %v. Skipping automatic role assignment.", roleDefinitionName, err)
+		return nil
+	}
+
+	roleAssignmentsClient := authorization.NewRoleAssignmentsClientWithBaseURI(env.ResourceManagerEndpoint, armConfig.SubscriptionId)
+	roleAssignmentsClient.Authorizer = armClient.Authorizer
+
+	terragruntOptions.Logger.Debugf("Assigning role %s on storage account %s to principal %s", roleDefinitionName, armConfig.StorageAccountName, principalID)
+
+	_, err = roleAssignmentsClient.Create(context.Background(), scope, uuid.New().String(), authorization.RoleAssignmentCreateParameters{
+		RoleAssignmentProperties: &authorization.RoleAssignmentProperties{
+			RoleDefinitionID: &roleDefinitionID,
+			PrincipalID:      &principalID,
+		},
+	})
+	if err != nil {
+		if isAuthorizationWriteDeniedError(err) {
+			terragruntOptions.Logger.Warnf("Current principal lacks Microsoft.Authorization/roleAssignments/write on storage account %s; skipping automatic role assignment", armConfig.StorageAccountName)
+			return nil
+		}
+
+		return errors.WithStackTrace(AzureRMRoleAssignmentError{RoleDefinitionName: roleDefinitionName, UnderlyingErr: err})
+	}
+
+	return nil
+}
+
+// roleDefinitionIDByName looks up the fully-qualified role definition ID for a built-in role name, such as
+// "Storage Blob Data Contributor", scoped to the given resource.
+func roleDefinitionIDByName(client authorization.RoleDefinitionsClient, scope string, roleDefinitionName string) (string, error) {
+	filter := fmt.Sprintf("roleName eq '%s'", roleDefinitionName)
+
+	page, err := client.List(context.Background(), scope, filter)
+	if err != nil {
+		return "", errors.WithStackTrace(err)
+	}
+
+	values := page.Values()
+	if len(values) == 0 {
+		return "", errors.WithStackTrace(fmt.Errorf("no role definition found with name %q", roleDefinitionName))
+	}
+
+	return *values[0].ID, nil
+}
+
+// principalIDForAzureRM resolves the object ID of the principal Terragrunt authenticated as, using the credential
+// type that was actually configured: the service principal's object ID for client secret/certificate auth, the
+// managed identity's object ID for MSI, or the signed-in user/service principal's object ID for
+// environment-variable auth.
+func principalIDForAzureRM(config RemoteStateConfigAzureRM, env azure.Environment) (string, error) {
+	switch {
+	case config.ClientId != "" && (config.ClientSecret != "" || config.ClientCertificatePath != ""):
+		return servicePrincipalObjectID(config, env)
+	default:
+		if useMSI, err := strconv.ParseBool(config.UseMSI); err == nil && useMSI {
+			return msiPrincipalID(config, env)
+		}
+
+		return signedInUserObjectID(config, env)
+	}
+}
+
+// servicePrincipalObjectID looks up the object ID of the service principal identified by the configured client ID.
+func servicePrincipalObjectID(config RemoteStateConfigAzureRM, env azure.Environment) (string, error) {
+	graphAuthorizer, err := auth.NewAuthorizerFromEnvironmentWithResource(env.GraphEndpoint)
+	if err != nil {
+		return "", errors.WithStackTrace(err)
+	}
+
+	client := graphrbac.NewServicePrincipalsClientWithBaseURI(env.GraphEndpoint, config.TenantId)
+	client.Authorizer = graphAuthorizer
+
+	filter := fmt.Sprintf("appId eq '%s'", config.ClientId)
+
+	page, err := client.List(context.Background(), filter)
+	if err != nil {
+		return "", errors.WithStackTrace(err)
+	}
+
+	values := page.Values()
+	if len(values) == 0 {
+		return "", errors.WithStackTrace(fmt.Errorf("no service principal found for client id %s", config.ClientId))
+	}
+
+	return *values[0].ObjectID, nil
+}
+
+// signedInUserObjectID returns the object ID of the currently signed in principal (the user or service principal
+// behind the ambient AZURE_* environment credentials).
+func signedInUserObjectID(config RemoteStateConfigAzureRM, env azure.Environment) (string, error) {
+	graphAuthorizer, err := auth.NewAuthorizerFromEnvironmentWithResource(env.GraphEndpoint)
+	if err != nil {
+		return "", errors.WithStackTrace(err)
+	}
+
+	client := graphrbac.NewSignedInUserClientWithBaseURI(env.GraphEndpoint, config.TenantId)
+	client.Authorizer = graphAuthorizer
+
+	user, err := client.Get(context.Background())
+	if err != nil {
+		return "", errors.WithStackTrace(err)
+	}
+
+	return *user.ObjectID, nil
+}
+
+// msiPrincipalID resolves the object ID of the managed identity Terragrunt is running as by decoding the "oid"
+// claim out of the access token IMDS issues for it.
+func msiPrincipalID(config RemoteStateConfigAzureRM, env azure.Environment) (string, error) {
+	msiConfig := auth.NewMSIConfig()
+	msiConfig.Resource = env.ResourceManagerEndpoint
+
+	if config.ClientId != "" {
+		msiConfig.ClientID = config.ClientId
+	}
+
+	servicePrincipalToken, err := msiConfig.ServicePrincipalToken()
+	if err != nil {
+		return "", errors.WithStackTrace(err)
+	}
+
+	if err := servicePrincipalToken.Refresh(); err != nil {
+		return "", errors.WithStackTrace(err)
+	}
+
+	claims, err := unverifiedJWTClaims(servicePrincipalToken.OAuthToken())
+	if err != nil {
+		return "", errors.WithStackTrace(err)
+	}
+
+	objectID, ok := claims["oid"].(string)
+	if !ok || objectID == "" {
+		return "", errors.WithStackTrace(fmt.Errorf("MSI access token is missing the oid claim"))
+	}
+
+	return objectID, nil
+}
+
+// unverifiedJWTClaims decodes the claims segment of a JWT without validating its signature. This is safe here
+// because the token was just issued to us directly by IMDS over the loopback address, not received from a
+// third party.
+func unverifiedJWTClaims(token string) (map[string]interface{}, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, fmt.Errorf("token is not a well-formed JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(segments[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// isAuthorizationWriteDeniedError returns true if the given error is the 403 ARM returns when the caller lacks
+// Microsoft.Authorization/roleAssignments/write on the target scope.
+func isAuthorizationWriteDeniedError(err error) bool {
+	return strings.Contains(err.Error(), "AuthorizationFailed")
+}
+
+// AzureRMRoleAssignmentError is returned when Terragrunt fails to assign the configured RBAC role to the principal
+// it authenticated as.
+type AzureRMRoleAssignmentError struct {
+	RoleDefinitionName string
+	UnderlyingErr      error
+}
+
+func (err AzureRMRoleAssignmentError) Error() string {
+	return fmt.Sprintf("Error assigning role %s: %v", err.RoleDefinitionName, err.UnderlyingErr)
+}
+
+func (err AzureRMRoleAssignmentError) Unwrap() error {
+	return err.UnderlyingErr
+}
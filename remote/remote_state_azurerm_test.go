@@ -0,0 +1,237 @@
+package remote
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gruntwork-io/terragrunt/errors"
+)
+
+func TestSkuForAzureRMStorageAccount(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		skuName     string
+		expectedSku string
+		expectErr   bool
+	}{
+		{"", "Standard_LRS", false},
+		{"Standard_LRS", "Standard_LRS", false},
+		{"Standard_GRS", "Standard_GRS", false},
+		{"Standard_RAGRS", "Standard_RAGRS", false},
+		{"Standard_ZRS", "Standard_ZRS", false},
+		{"Standard_GZRS", "Standard_GZRS", false},
+		{"Standard_RAGZRS", "Standard_RAGZRS", false},
+		{"Premium_LRS", "Premium_LRS", false},
+		{"Premium_ZRS", "Premium_ZRS", false},
+		{"Not_A_Real_Sku", "", true},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.skuName, func(t *testing.T) {
+			t.Parallel()
+
+			sku, err := skuForAzureRMStorageAccount(testCase.skuName)
+
+			if testCase.expectErr {
+				assert.Error(t, err)
+				assert.IsType(t, InvalidAzureRMStorageSKU(""), errors.Unwrap(err))
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expectedSku, string(sku.Name))
+		})
+	}
+}
+
+func TestValidateAzureRMConfig(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		config      ExtendedRemoteStateConfigAzureRM
+		expectedErr interface{}
+	}{
+		{
+			name:        "missing storage account name",
+			config:      ExtendedRemoteStateConfigAzureRM{},
+			expectedErr: MissingRequiredAzureRMRemoteStateConfig(""),
+		},
+		{
+			name: "valid minimal config defaults to StorageV2",
+			config: ExtendedRemoteStateConfigAzureRM{
+				remoteStateConfigAzureRM: RemoteStateConfigAzureRM{StorageAccountName: "tfstate12345"},
+			},
+		},
+		{
+			name: "storage account name too short",
+			config: ExtendedRemoteStateConfigAzureRM{
+				remoteStateConfigAzureRM: RemoteStateConfigAzureRM{StorageAccountName: "ab"},
+			},
+			expectedErr: InvalidAzureRMStorageAccountName(""),
+		},
+		{
+			name: "storage account name with uppercase letters",
+			config: ExtendedRemoteStateConfigAzureRM{
+				remoteStateConfigAzureRM: RemoteStateConfigAzureRM{StorageAccountName: "TFState12345"},
+			},
+			expectedErr: InvalidAzureRMStorageAccountName(""),
+		},
+		{
+			name: "invalid kind",
+			config: ExtendedRemoteStateConfigAzureRM{
+				remoteStateConfigAzureRM: RemoteStateConfigAzureRM{StorageAccountName: "tfstate12345"},
+				Kind:                     "NotARealKind",
+			},
+			expectedErr: InvalidAzureRMStorageKind(""),
+		},
+		{
+			name: "invalid sku",
+			config: ExtendedRemoteStateConfigAzureRM{
+				remoteStateConfigAzureRM: RemoteStateConfigAzureRM{StorageAccountName: "tfstate12345"},
+				SKU:                      "Not_A_Real_Sku",
+			},
+			expectedErr: InvalidAzureRMStorageSKU(""),
+		},
+		{
+			name: "Premium_LRS rejected with default StorageV2 kind",
+			config: ExtendedRemoteStateConfigAzureRM{
+				remoteStateConfigAzureRM: RemoteStateConfigAzureRM{StorageAccountName: "tfstate12345"},
+				SKU:                      "Premium_LRS",
+			},
+			expectedErr: InvalidAzureRMSKUKindCombo{},
+		},
+		{
+			name: "Premium_LRS allowed with BlockBlobStorage kind",
+			config: ExtendedRemoteStateConfigAzureRM{
+				remoteStateConfigAzureRM: RemoteStateConfigAzureRM{StorageAccountName: "tfstate12345"},
+				SKU:                      "Premium_LRS",
+				Kind:                     "BlockBlobStorage",
+			},
+		},
+		{
+			name: "invalid access tier",
+			config: ExtendedRemoteStateConfigAzureRM{
+				remoteStateConfigAzureRM: RemoteStateConfigAzureRM{StorageAccountName: "tfstate12345"},
+				AccessTier:               "Frozen",
+			},
+			expectedErr: InvalidAzureRMAccessTier(""),
+		},
+		{
+			name: "Archive access tier allowed on StorageV2",
+			config: ExtendedRemoteStateConfigAzureRM{
+				remoteStateConfigAzureRM: RemoteStateConfigAzureRM{StorageAccountName: "tfstate12345"},
+				AccessTier:               "Archive",
+			},
+		},
+		{
+			name: "Archive access tier allowed on BlobStorage",
+			config: ExtendedRemoteStateConfigAzureRM{
+				remoteStateConfigAzureRM: RemoteStateConfigAzureRM{StorageAccountName: "tfstate12345"},
+				Kind:                     "BlobStorage",
+				AccessTier:               "Archive",
+			},
+		},
+		{
+			name: "Archive access tier rejected on BlockBlobStorage",
+			config: ExtendedRemoteStateConfigAzureRM{
+				remoteStateConfigAzureRM: RemoteStateConfigAzureRM{StorageAccountName: "tfstate12345"},
+				Kind:                     "BlockBlobStorage",
+				AccessTier:               "Archive",
+			},
+			expectedErr: InvalidAzureRMAccessTierKindCombo{},
+		},
+		{
+			name: "Archive access tier rejected on FileStorage",
+			config: ExtendedRemoteStateConfigAzureRM{
+				remoteStateConfigAzureRM: RemoteStateConfigAzureRM{StorageAccountName: "tfstate12345"},
+				Kind:                     "FileStorage",
+				AccessTier:               "Archive",
+			},
+			expectedErr: InvalidAzureRMAccessTierKindCombo{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateAzureRMConfig(&testCase.config, nil)
+
+			if testCase.expectedErr != nil {
+				require.Error(t, err)
+				assert.IsType(t, testCase.expectedErr, errors.Unwrap(err))
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAzureRMEnvironment(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                string
+		config              RemoteStateConfigAzureRM
+		expectedARMEndpoint string
+		expectErr           bool
+	}{
+		{
+			name:                "defaults to the public cloud",
+			config:              RemoteStateConfigAzureRM{},
+			expectedARMEndpoint: "https://management.azure.com/",
+		},
+		{
+			name:                "usgovernment resolves to the US Government cloud",
+			config:              RemoteStateConfigAzureRM{Environment: "usgovernment"},
+			expectedARMEndpoint: "https://management.usgovcloudapi.net/",
+		},
+		{
+			name:                "china resolves to the China cloud",
+			config:              RemoteStateConfigAzureRM{Environment: "china"},
+			expectedARMEndpoint: "https://management.chinacloudapi.cn/",
+		},
+		{
+			name:                "german resolves to the Germany cloud",
+			config:              RemoteStateConfigAzureRM{Environment: "german"},
+			expectedARMEndpoint: "https://management.microsoftazure.de/",
+		},
+		{
+			name:      "unknown environment name errors",
+			config:    RemoteStateConfigAzureRM{Environment: "not-a-real-cloud"},
+			expectErr: true,
+		},
+		{
+			name:      "stack without an endpoint errors",
+			config:    RemoteStateConfigAzureRM{Environment: "stack"},
+			expectErr: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			env, err := azureRMEnvironment(testCase.config)
+
+			if testCase.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expectedARMEndpoint, env.ResourceManagerEndpoint)
+		})
+	}
+}